@@ -0,0 +1,391 @@
+// Copyright 2019 siddontang All Rights Reserved.
+//
+// Licensed under the MIT License;
+// License can be found in the LICENSES/go-mysql-LICENSE.
+//
+// Copyright 2019 ByteWatch All Rights Reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/juju/errors"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/siddontang/go-log/log"
+)
+
+// defaultChunkSize is used by dumpChunkedAndParse when SetChunkSize wasn't
+// called.
+const defaultChunkSize = 100000
+
+func (d *Dumper) dsn(schema string) string {
+	cfg := newDSNConfig(d.Addr, d.User, d.Password, d.Charset)
+	cfg.DBName = schema
+	return cfg.FormatDSN()
+}
+
+// chunkTable is a table selected for the chunked dump path. column is empty
+// when the table has no single numeric primary key, in which case it falls
+// back to a serial, unscoped dump.
+type chunkTable struct {
+	schema, table, column string
+	lo, hi                int64
+}
+
+// dumpChunkedAndParse is the parallel counterpart to DumpAndParse, used
+// when SetParallelism(n) with n > 1 is set. It emits schema DDL and the
+// binlog/GTID header exactly once, then fans the selected tables' data out
+// across workers by primary-key range.
+//
+// The binlog/GTID header is captured once, before any chunk worker starts;
+// each worker then opens its own independent --single-transaction snapshot
+// moments later. That's an inherent gap in the chunked path, not just a
+// consistentSnapshot quirk: SetConsistentSnapshot's whole premise is a
+// single snapshot the caller can rely on for CDC replay, which this fan-out
+// can't uphold, so the two are rejected together rather than silently
+// producing a header that doesn't match the data.
+func (d *Dumper) dumpChunkedAndParse(h ParseHandler) error {
+	if d.consistentSnapshot {
+		return errors.Errorf("dump: SetConsistentSnapshot is incompatible with SetParallelism; each chunk worker runs its own separate snapshot, so no single snapshot covers the whole dump")
+	}
+
+	if err := d.resolveTableRegex(); err != nil {
+		return errors.Trace(err)
+	}
+
+	chunkSize := d.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	db, err := sql.Open("mysql", d.dsn(""))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+
+	parseBinlogPosition := !d.masterDataSkipped || d.consistentSnapshot
+	parseGTID := parseBinlogPosition && d.gtidEnabled
+
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := Parse(r, h, parseBinlogPosition, parseGTID)
+		r.CloseWithError(err)
+		done <- err
+	}()
+
+	err = d.dumpChunked(w, db, chunkSize)
+	w.CloseWithError(err)
+
+	if perr := <-done; err == nil {
+		err = perr
+	}
+
+	return errors.Trace(err)
+}
+
+// dumpSchemaOnly runs Dump with data dumping forced off, regardless of
+// SetDumpData, then restores the previous setting. It's used to emit the
+// schema/header exactly once before the chunked workers, which are
+// responsible for any row data, dump each table's range.
+func (d *Dumper) dumpSchemaOnly(w io.Writer) error {
+	prev := d.dumpData
+	d.dumpData = false
+	defer func() { d.dumpData = prev }()
+
+	return errors.Trace(d.Dump(w))
+}
+
+func (d *Dumper) dumpChunked(w io.Writer, db *sql.DB, chunkSize int) error {
+	// Schema DDL and the binlog/GTID header must appear exactly once, at
+	// the head of the stream, before any worker writes data. Row data, if
+	// any, is emitted below by the per-chunk workers, so this call must not
+	// also emit it or every row ends up duplicated. See SetParallelism's
+	// doc comment for why the header position this captures is only
+	// approximate relative to what the chunk workers below actually read.
+	if err := d.dumpSchemaOnly(w); err != nil {
+		return errors.Trace(err)
+	}
+
+	if !d.dumpData {
+		// Nothing left to fan out: parallelism only speeds up row data.
+		return nil
+	}
+
+	tables, err := d.chunkableTables(db)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// Build the full job list up front: a table with a usable PK fans out
+	// into len(splitRange(...)) chunk jobs, a table without one is a single
+	// job. Worker errors are collected in errs under errMu.
+	type job struct {
+		t     chunkTable
+		where string
+	}
+	var jobs []job
+	for _, t := range tables {
+		if t.column == "" {
+			// No usable PK: fall back to a single, unscoped dump.
+			jobs = append(jobs, job{t, ""})
+			continue
+		}
+		for _, rg := range splitRange(t.lo, t.hi, int64(chunkSize)) {
+			jobs = append(jobs, job{t, fmt.Sprintf("`%s` BETWEEN %d AND %d", t.column, rg[0], rg[1])})
+		}
+	}
+
+	var mu sync.Mutex // serializes writes to w so chunks never interleave mid-statement
+
+	var errMu sync.Mutex
+	var errs []error
+
+	sem := make(chan struct{}, d.parallelism)
+	var wg sync.WaitGroup
+
+	for _, j := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(j job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := d.dumpTableChunk(w, &mu, j.t.schema, j.t.table, j.where); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+			}
+		}(j)
+	}
+
+	wg.Wait()
+	if len(errs) > 0 {
+		return errors.Trace(errs[0])
+	}
+
+	return nil
+}
+
+// dumpTableChunk runs a scoped mysqldump for a single table/PK range into a
+// buffer, then writes it to w under mu. w is typically the write end of an
+// io.Pipe, so a slow ParseHandler on the read end naturally applies
+// backpressure to this write rather than letting buffers grow unbounded.
+func (d *Dumper) dumpTableChunk(w io.Writer, mu *sync.Mutex, schema, table, where string) error {
+	args := []string{
+		fmt.Sprintf("--host=%s", hostOf(d.Addr)),
+		fmt.Sprintf("--user=%s", d.User),
+		fmt.Sprintf("--password=%s", d.Password),
+		"--no-create-info",
+		"--skip-extended-insert",
+		"--compact",
+		"--skip-opt",
+		"--quick",
+		"--single-transaction",
+		"--skip-lock-tables",
+	}
+	if port := portOf(d.Addr); port != "" {
+		args = append(args, fmt.Sprintf("--port=%s", port))
+	}
+	if d.hexBlob {
+		args = append(args, "--hex-blob")
+	}
+	if where != "" {
+		args = append(args, fmt.Sprintf("--where=%s", where))
+	} else if d.Where != "" {
+		args = append(args, fmt.Sprintf("--where=%s", d.Where))
+	}
+	args = append(args, schema, table)
+
+	log.Infof("exec mysqldump chunk with %v", args)
+	cmd := exec.Command(d.ExecutionPath, args...)
+	cmd.Stderr = d.ErrOut
+
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	if err := cmd.Run(); err != nil {
+		return errors.Trace(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// --compact output has no USE line; add one so Parse attributes these
+	// rows to schema rather than to the last schema seen in the stream.
+	if _, err := fmt.Fprintf(w, "USE `%s`;\n", schema); err != nil {
+		return errors.Trace(err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return errors.Trace(err)
+}
+
+func hostOf(addr string) string {
+	for i := 0; i < len(addr); i++ {
+		if addr[i] == ':' {
+			return addr[:i]
+		}
+	}
+	return addr
+}
+
+func portOf(addr string) string {
+	for i := 0; i < len(addr); i++ {
+		if addr[i] == ':' {
+			return addr[i+1:]
+		}
+	}
+	return ""
+}
+
+// chunkableTables resolves the tables selected by Tables/Databases (every
+// user schema when neither is set, as with Dump's --all-databases; and any
+// regex filters already applied via resolveTableRegex) and, for each,
+// looks up a single numeric/AUTO_INCREMENT primary key plus its MIN/MAX, so
+// dumpChunked can split it into ranges. Tables without such a PK get an
+// empty column, signalling the serial fallback.
+func (d *Dumper) chunkableTables(db *sql.DB) ([]chunkTable, error) {
+	schemas := d.Databases
+	if len(d.Tables) != 0 {
+		schemas = []string{d.TableDB}
+	}
+	if len(schemas) == 0 {
+		rows, err := db.Query("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME NOT IN ('information_schema', 'performance_schema', 'mysql', 'sys')")
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for rows.Next() {
+			var schema string
+			if err := rows.Scan(&schema); err != nil {
+				rows.Close()
+				return nil, errors.Trace(err)
+			}
+			schemas = append(schemas, schema)
+		}
+		rows.Close()
+	}
+
+	var tables []chunkTable
+	for _, schema := range schemas {
+		names := d.Tables
+		if len(names) == 0 {
+			rows, err := db.Query("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'", schema)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					rows.Close()
+					return nil, errors.Trace(err)
+				}
+				if !d.ignoredTable(schema, name) {
+					names = append(names, name)
+				}
+			}
+			if err := rows.Err(); err != nil {
+				rows.Close()
+				return nil, errors.Trace(err)
+			}
+			rows.Close()
+		}
+
+		for _, table := range names {
+			t, err := d.chunkableTable(db, schema, table)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			tables = append(tables, t)
+		}
+	}
+
+	return tables, nil
+}
+
+func (d *Dumper) ignoredTable(schema, table string) bool {
+	for _, t := range d.IgnoreTables[schema] {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Dumper) chunkableTable(db *sql.DB, schema, table string) (chunkTable, error) {
+	t := chunkTable{schema: schema, table: table}
+
+	var column string
+	var dataType string
+	row := db.QueryRow(`
+		SELECT k.COLUMN_NAME, c.DATA_TYPE
+		FROM information_schema.KEY_COLUMN_USAGE k
+		JOIN information_schema.COLUMNS c
+		  ON c.TABLE_SCHEMA = k.TABLE_SCHEMA AND c.TABLE_NAME = k.TABLE_NAME AND c.COLUMN_NAME = k.COLUMN_NAME
+		WHERE k.CONSTRAINT_NAME = 'PRIMARY' AND k.TABLE_SCHEMA = ? AND k.TABLE_NAME = ?
+		ORDER BY k.ORDINAL_POSITION
+		LIMIT 2`, schema, table)
+	if err := row.Scan(&column, &dataType); err != nil {
+		if err == sql.ErrNoRows {
+			return t, nil
+		}
+		return t, errors.Trace(err)
+	}
+	var pkColumns int
+	if err := db.QueryRow("SELECT COUNT(*) FROM information_schema.KEY_COLUMN_USAGE WHERE CONSTRAINT_NAME = 'PRIMARY' AND TABLE_SCHEMA = ? AND TABLE_NAME = ?", schema, table).Scan(&pkColumns); err != nil {
+		return t, errors.Trace(err)
+	}
+	if pkColumns != 1 {
+		return t, nil
+	}
+	switch dataType {
+	case "int", "bigint", "mediumint", "smallint", "tinyint":
+	default:
+		return t, nil
+	}
+
+	if err := db.QueryRow(fmt.Sprintf("SELECT MIN(`%s`), MAX(`%s`) FROM `%s`.`%s`", column, column, schema, table)).Scan(&t.lo, &t.hi); err != nil {
+		if err == sql.ErrNoRows {
+			return chunkTable{schema: schema, table: table}, nil
+		}
+		return t, errors.Trace(err)
+	}
+
+	t.column = column
+	return t, nil
+}
+
+// splitRange divides [lo, hi] into inclusive chunks of at most size rows.
+func splitRange(lo, hi, size int64) [][2]int64 {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	if hi < lo {
+		return nil
+	}
+
+	var ranges [][2]int64
+	for start := lo; start <= hi; start += size {
+		end := start + size - 1
+		if end > hi {
+			end = hi
+		}
+		ranges = append(ranges, [2]int64{start, end})
+	}
+	return ranges
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 siddontang All Rights Reserved.
+//
+// Licensed under the MIT License;
+// License can be found in the LICENSES/go-mysql-LICENSE.
+//
+// Copyright 2019 ByteWatch All Rights Reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitRange(t *testing.T) {
+	cases := []struct {
+		lo, hi, size int64
+		want         [][2]int64
+	}{
+		{1, 10, 5, [][2]int64{{1, 5}, {6, 10}}},
+		{1, 1, 5, [][2]int64{{1, 1}}},
+		{5, 1, 5, nil},
+		{0, 9, 3, [][2]int64{{0, 2}, {3, 5}, {6, 8}, {9, 9}}},
+	}
+
+	for _, c := range cases {
+		got := splitRange(c.lo, c.hi, c.size)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitRange(%d, %d, %d) = %v, want %v", c.lo, c.hi, c.size, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 siddontang All Rights Reserved.
+//
+// Licensed under the MIT License;
+// License can be found in the LICENSES/go-mysql-LICENSE.
+//
+// Copyright 2019 ByteWatch All Rights Reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// newDSNConfig builds a go-sql-driver/mysql Config for addr/user/password,
+// so every database/sql caller in this package formats its DSN through
+// Config.FormatDSN instead of hand-rolled fmt.Sprintf, which breaks on
+// passwords containing '@', ':' or '/'. Callers may set DBName,
+// InterpolateParams, etc. on the returned Config before calling FormatDSN.
+func newDSNConfig(addr, user, password, charset string) *mysqldriver.Config {
+	cfg := &mysqldriver.Config{
+		Net:    "tcp",
+		Addr:   addr,
+		User:   user,
+		Passwd: password,
+	}
+	if len(charset) != 0 {
+		cfg.Params = map[string]string{"charset": charset}
+	}
+	return cfg
+}
@@ -24,6 +24,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 
 	"github.com/juju/errors"
@@ -58,11 +59,32 @@ type Dumper struct {
 
 	maxAllowedPacket int
 	hexBlob          bool
+	dumpData         bool
+
+	includeTableRegex []*regexp.Regexp
+	excludeTableRegex []*regexp.Regexp
+
+	parallelism int
+	chunkSize   int
+
+	consistentSnapshot bool
 }
 
-func NewDumper(executionPath string, addr string, user string, password string) (*Dumper, error) {
+// Interface is implemented by both Dumper, which shells out to the
+// mysqldump binary, and NativeDumper, the pure Go dumper. NewDumper returns
+// whichever one fits the given executionPath, and callers can treat the
+// result the same way either way.
+type Interface interface {
+	Dump(w io.Writer) error
+	DumpAndParse(h ParseHandler) error
+}
+
+// NewDumper returns a Dumper that shells out to the mysqldump binary at
+// executionPath. If executionPath is empty, it instead returns a
+// NativeDumper, which needs no external binary.
+func NewDumper(executionPath string, addr string, user string, password string) (Interface, error) {
 	if len(executionPath) == 0 {
-		return nil, nil
+		return NewNativeDumper(addr, user, password)
 	}
 
 	path, err := exec.LookPath(executionPath)
@@ -107,6 +129,22 @@ func (d *Dumper) SkipMasterData(v bool) {
 	d.masterDataSkipped = v
 }
 
+// SetConsistentSnapshot enables an alternative to --master-data for cloud
+// MySQL where SkipMasterData(true) would otherwise lose the binlog
+// position entirely: before running mysqldump, Dump opens its own
+// connection, starts a consistent-snapshot transaction and reads the
+// binlog/GTID coordinates through it, so mysqldump itself never needs
+// SUPER/RELOAD privilege.
+//
+// mysqldump does not read through this transaction: it still runs with its
+// own --single-transaction snapshot, started after this one.
+//
+// It is incompatible with SetParallelism(n > 1): dumpChunkedAndParse rejects
+// that combination with an error.
+func (d *Dumper) SetConsistentSnapshot(v bool) {
+	d.consistentSnapshot = v
+}
+
 func (d *Dumper) SetMaxAllowedPacket(i int) {
 	d.maxAllowedPacket = i
 }
@@ -115,6 +153,37 @@ func (d *Dumper) SetHexBlob(v bool) {
 	d.hexBlob = v
 }
 
+// SetDumpData enables dumping row data in addition to schema. By default
+// Dump only emits DDL (--no-data); with this enabled it drops --no-data and
+// keeps --hex-blob/--skip-extended-insert, so Parse can hand each row to a
+// RowParseHandler via its TypedData callback.
+func (d *Dumper) SetDumpData(v bool) {
+	d.dumpData = v
+}
+
+// SetParallelism enables the chunked dump path: tables with a suitable
+// numeric primary key are split into n concurrently dumped PK ranges
+// instead of being dumped by a single mysqldump invocation. n <= 1 keeps
+// the existing serial behavior. Only DumpAndParse takes the chunked path;
+// Dump always runs a single mysqldump.
+//
+// The binlog/GTID header is still captured once up front, but each chunk
+// worker then opens its own later, independent --single-transaction
+// snapshot, so the header position is only approximate for the chunked
+// path — rows committed in the gap between the header and a given chunk's
+// snapshot can be double-applied or missed on binlog replay. Use
+// SetConsistentSnapshot with n <= 1 when that gap isn't acceptable; the two
+// can't be combined (see SetConsistentSnapshot).
+func (d *Dumper) SetParallelism(n int) {
+	d.parallelism = n
+}
+
+// SetChunkSize sets the number of rows each worker dumps per PK range when
+// SetParallelism is active. Defaults to defaultChunkSize.
+func (d *Dumper) SetChunkSize(rows int) {
+	d.chunkSize = rows
+}
+
 func (d *Dumper) AddDatabases(dbs ...string) {
 	d.Databases = append(d.Databases, dbs...)
 }
@@ -143,6 +212,19 @@ func (d *Dumper) Reset() {
 }
 
 func (d *Dumper) Dump(w io.Writer) error {
+	if err := d.resolveTableRegex(); err != nil {
+		return errors.Trace(err)
+	}
+
+	var snap *consistentSnapshot
+	if d.consistentSnapshot {
+		var err error
+		if snap, err = d.captureConsistentSnapshot(w); err != nil {
+			return errors.Trace(err)
+		}
+		defer snap.Close()
+	}
+
 	args := make([]string, 0, 16)
 
 	// Common args
@@ -155,12 +237,14 @@ func (d *Dumper) Dump(w io.Writer) error {
 	args = append(args, fmt.Sprintf("--user=%s", d.User))
 	args = append(args, fmt.Sprintf("--password=%s", d.Password))
 
-	if !d.masterDataSkipped {
+	if !d.masterDataSkipped && !d.consistentSnapshot {
 		args = append(args, "--master-data")
 	}
 
-	// We need only schema info
-	args = append(args, "--no-data")
+	if !d.dumpData {
+		// We need only schema info
+		args = append(args, "--no-data")
+	}
 
 	if d.maxAllowedPacket > 0 {
 		// mysqldump param should be --max-allowed-packet=%dM not be --max_allowed_packet=%dM
@@ -224,12 +308,23 @@ func (d *Dumper) Dump(w io.Writer) error {
 
 // Dump MySQL and parse immediately
 func (d *Dumper) DumpAndParse(h ParseHandler) error {
+	if d.parallelism > 1 {
+		return errors.Trace(d.dumpChunkedAndParse(h))
+	}
+
+	// A consistent snapshot writes its own CHANGE MASTER TO/GTID_PURGED
+	// header even when masterDataSkipped is set (that's the whole point:
+	// recovering the position without --master-data), so Parse must still
+	// look for it in that case.
+	parseBinlogPosition := !d.masterDataSkipped || d.consistentSnapshot
+	parseGTID := parseBinlogPosition && d.gtidEnabled
+
 	// TODO: Support parse with backup file
 	r, w := io.Pipe()
 
 	done := make(chan error, 1)
 	go func() {
-		err := Parse(r, h, !d.masterDataSkipped, !d.masterDataSkipped && d.gtidEnabled)
+		err := Parse(r, h, parseBinlogPosition, parseGTID)
 		r.CloseWithError(err)
 		done <- err
 	}()
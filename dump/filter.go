@@ -0,0 +1,167 @@
+// Copyright 2019 siddontang All Rights Reserved.
+//
+// Licensed under the MIT License;
+// License can be found in the LICENSES/go-mysql-LICENSE.
+//
+// Copyright 2019 ByteWatch All Rights Reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	"database/sql"
+	"regexp"
+
+	"github.com/juju/errors"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// SetIncludeTableRegex restricts the dump to tables whose "db.table" name
+// matches one of the given patterns, among the tables already selected via
+// AddTables/AddDatabases (all databases if neither was used). Outside the
+// explicit AddTables mode it is resolved against information_schema.TABLES
+// the next time Dump runs, so newly created tables are picked up without
+// touching the config again.
+func (d *Dumper) SetIncludeTableRegex(patterns []string) error {
+	res, err := compileTableRegex(patterns)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	d.includeTableRegex = res
+	return nil
+}
+
+// SetExcludeTableRegex drops tables whose "db.table" name matches one of
+// the given patterns. It takes precedence over SetIncludeTableRegex.
+func (d *Dumper) SetExcludeTableRegex(patterns []string) error {
+	res, err := compileTableRegex(patterns)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	d.excludeTableRegex = res
+	return nil
+}
+
+func compileTableRegex(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchesAny(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTableRegex expands includeTableRegex/excludeTableRegex against
+// information_schema.TABLES. When Dump is in its explicit-table-list mode
+// (d.Tables/d.TableDB set), that list is pruned in place and
+// information_schema is not queried. Otherwise, non-matching tables are
+// turned into IgnoreTables entries, so Dump
+// builds the mysqldump command line the same way it already does for
+// explicit --ignore-table flags.
+func (d *Dumper) resolveTableRegex() error {
+	if len(d.includeTableRegex) == 0 && len(d.excludeTableRegex) == 0 {
+		return nil
+	}
+
+	if len(d.Tables) != 0 {
+		return d.filterExplicitTables()
+	}
+
+	cfg := newDSNConfig(d.Addr, d.User, d.Password, d.Charset)
+	cfg.DBName = "information_schema"
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE'")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rows.Close()
+
+	schemas := make(map[string]bool)
+	for rows.Next() {
+		var schema, table string
+		if err := rows.Scan(&schema, &table); err != nil {
+			return errors.Trace(err)
+		}
+
+		switch schema {
+		case "information_schema", "performance_schema", "mysql", "sys":
+			continue
+		}
+		if len(d.Databases) != 0 && !contains(d.Databases, schema) {
+			continue
+		}
+
+		name := schema + "." + table
+		included := len(d.includeTableRegex) == 0 || matchesAny(d.includeTableRegex, name)
+		excluded := matchesAny(d.excludeTableRegex, name)
+
+		schemas[schema] = true
+		if !included || excluded {
+			d.AddIgnoreTables(schema, table)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	if len(d.Databases) == 0 {
+		for schema := range schemas {
+			d.Databases = append(d.Databases, schema)
+		}
+	}
+
+	return nil
+}
+
+// filterExplicitTables prunes d.Tables in place against
+// includeTableRegex/excludeTableRegex, for the explicit-table-list mode.
+func (d *Dumper) filterExplicitTables() error {
+	kept := d.Tables[:0]
+	for _, table := range d.Tables {
+		name := d.TableDB + "." + table
+		included := len(d.includeTableRegex) == 0 || matchesAny(d.includeTableRegex, name)
+		excluded := matchesAny(d.excludeTableRegex, name)
+		if included && !excluded {
+			kept = append(kept, table)
+		}
+	}
+	d.Tables = kept
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,343 @@
+// Copyright 2019 siddontang All Rights Reserved.
+//
+// Licensed under the MIT License;
+// License can be found in the LICENSES/go-mysql-LICENSE.
+//
+// Copyright 2019 ByteWatch All Rights Reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// ParseHandler receives the binlog position captured at dump time (once,
+// if present) and every row found in the dump's single-row INSERT INTO
+// statements. DDL statements are consumed by Parse but not forwarded,
+// since Parse is meant to seed a destination whose schema already exists.
+type ParseHandler interface {
+	BinLog(name string, pos uint64) error
+
+	Data(schema string, table string, values []string) error
+}
+
+// RowParseHandler additionally receives typed values for each row, so
+// callers don't have to re-parse the string literals Data already gives
+// them. Parse type-asserts h against it after every Data call.
+type RowParseHandler interface {
+	ParseHandler
+
+	// TypedData is called with the column names (from the preceding
+	// "INSERT INTO ... (col, ...)" clause, or positional "col1".."colN" if
+	// mysqldump omitted them) and typed values: int64, float64, string,
+	// []byte for 0x... hex literals, or nil for NULL. A BLOB/BINARY value
+	// dumped without --hex-blob is a quoted literal and arrives as a string.
+	TypedData(schema string, table string, columns []string, row []interface{}) error
+}
+
+const insertIntoPrefix = "INSERT INTO "
+
+// Parse reads a mysqldump-style SQL stream (as emitted by Dumper.Dump or
+// NativeDumper.Dump) from r and dispatches it to h.
+func Parse(r io.Reader, h ParseHandler, parseBinlogPosition bool, parseGTID bool) error {
+	rb := bufio.NewReaderSize(r, 1024*16)
+
+	var db string
+
+	for {
+		line, err := rb.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.Trace(err)
+		}
+
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+
+		switch {
+		case parseBinlogPosition && strings.HasPrefix(line, "-- CHANGE MASTER TO"):
+			name, pos, perr := parseChangeMasterTo(line)
+			if perr != nil {
+				return errors.Trace(perr)
+			}
+			if err := h.BinLog(name, pos); err != nil {
+				return errors.Trace(err)
+			}
+		case parseGTID && strings.HasPrefix(line, "SET @@GLOBAL.GTID_PURGED"):
+			// The GTID set isn't surfaced through ParseHandler; just make
+			// sure it isn't mistaken for an INSERT below.
+		case strings.HasPrefix(line, "USE `"):
+			if name, _, perr := parseBacktickName(line[len("USE "):]); perr == nil {
+				db = name
+			}
+		case strings.HasPrefix(line, insertIntoPrefix):
+			if err := parseInsert(line, db, h); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return nil
+}
+
+func parseChangeMasterTo(line string) (string, uint64, error) {
+	// -- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000001', MASTER_LOG_POS=4;
+	const fileKey = "MASTER_LOG_FILE='"
+	const posKey = "MASTER_LOG_POS="
+
+	fi := strings.Index(line, fileKey)
+	pi := strings.Index(line, posKey)
+	if fi < 0 || pi < 0 {
+		return "", 0, errors.Errorf("invalid CHANGE MASTER TO line: %s", line)
+	}
+
+	fi += len(fileKey)
+	fend := strings.IndexByte(line[fi:], '\'')
+	if fend < 0 {
+		return "", 0, errors.Errorf("invalid CHANGE MASTER TO line: %s", line)
+	}
+	name := line[fi : fi+fend]
+
+	pi += len(posKey)
+	pend := strings.IndexByte(line[pi:], ';')
+	if pend < 0 {
+		pend = len(line) - pi
+	}
+	pos, err := strconv.ParseUint(line[pi:pi+pend], 10, 64)
+	if err != nil {
+		return "", 0, errors.Trace(err)
+	}
+
+	return name, pos, nil
+}
+
+// parseInsert handles a single-row "INSERT INTO `table` [(`col`, ...)]
+// VALUES (...);" statement, as produced by --skip-extended-insert.
+func parseInsert(line string, db string, h ParseHandler) error {
+	rest := line[len(insertIntoPrefix):]
+
+	table, rest, err := parseBacktickName(rest)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	rest = strings.TrimSpace(rest)
+
+	var columns []string
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return errors.Errorf("invalid INSERT statement: %s", line)
+		}
+		for _, c := range strings.Split(rest[1:end], ",") {
+			columns = append(columns, strings.Trim(strings.TrimSpace(c), "`"))
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	if !strings.HasPrefix(rest, "VALUES") {
+		return errors.Errorf("invalid INSERT statement: %s", line)
+	}
+	rest = strings.TrimSpace(rest[len("VALUES"):])
+	rest = strings.TrimSuffix(strings.TrimSpace(rest), ";")
+	rest = strings.TrimSpace(rest)
+	rest = strings.TrimPrefix(rest, "(")
+	rest = strings.TrimSuffix(rest, ")")
+
+	rawValues, err := splitValues(rest)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if len(columns) == 0 {
+		columns = make([]string, len(rawValues))
+		for i := range columns {
+			columns[i] = fmt.Sprintf("col%d", i+1)
+		}
+	}
+
+	values := make([]string, len(rawValues))
+	for i, v := range rawValues {
+		values[i] = unescapeValue(v)
+	}
+
+	if err := h.Data(db, table, values); err != nil {
+		return errors.Trace(err)
+	}
+
+	if rh, ok := h.(RowParseHandler); ok {
+		row := make([]interface{}, len(rawValues))
+		for i, v := range rawValues {
+			row[i] = typedValue(v)
+		}
+		if err := rh.TypedData(db, table, columns, row); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+func parseBacktickName(s string) (name string, rest string, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "`") {
+		return "", "", errors.Errorf("expected backtick-quoted name: %s", s)
+	}
+	end := strings.IndexByte(s[1:], '`')
+	if end < 0 {
+		return "", "", errors.Errorf("unterminated backtick-quoted name: %s", s)
+	}
+	return s[1 : end+1], s[end+2:], nil
+}
+
+// splitValues splits a VALUES(...) tuple's contents on top-level commas,
+// respecting quoted strings (with '' and \ escapes).
+func splitValues(s string) ([]string, error) {
+	var values []string
+	var cur strings.Builder
+
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch c {
+		case '\'':
+			cur.WriteByte(c)
+			i++
+			for i < len(s) {
+				if s[i] == '\\' && i+1 < len(s) {
+					cur.WriteByte(s[i])
+					cur.WriteByte(s[i+1])
+					i += 2
+					continue
+				}
+				if s[i] == '\'' {
+					if i+1 < len(s) && s[i+1] == '\'' {
+						cur.WriteByte('\'')
+						cur.WriteByte('\'')
+						i += 2
+						continue
+					}
+					cur.WriteByte('\'')
+					i++
+					break
+				}
+				cur.WriteByte(s[i])
+				i++
+			}
+		case ',':
+			values = append(values, strings.TrimSpace(cur.String()))
+			cur.Reset()
+			i++
+		default:
+			cur.WriteByte(c)
+			i++
+		}
+	}
+	if cur.Len() > 0 || len(values) > 0 {
+		values = append(values, strings.TrimSpace(cur.String()))
+	}
+
+	return values, nil
+}
+
+// typedValue converts a single literal, as produced by splitValues, into a
+// Go value.
+func typedValue(v string) interface{} {
+	switch {
+	case v == "NULL":
+		return nil
+	case strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X"):
+		b := make([]byte, 0, (len(v)-2)/2)
+		for i := 2; i+1 < len(v); i += 2 {
+			n, err := strconv.ParseUint(v[i:i+2], 16, 8)
+			if err != nil {
+				return v
+			}
+			b = append(b, byte(n))
+		}
+		return b
+	case len(v) >= 2 && strings.HasPrefix(v, "'") && strings.HasSuffix(v, "'"):
+		return unescapeValue(v)
+	default:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		return v
+	}
+}
+
+// unescapeValue strips the surrounding quotes from a quoted literal (as
+// produced by splitValues) and unescapes it; anything else (NULL, numbers,
+// 0x... hex) is returned unchanged.
+func unescapeValue(v string) string {
+	if len(v) < 2 || v[0] != '\'' || v[len(v)-1] != '\'' {
+		return v
+	}
+	return unescapeSQLString(v[1 : len(v)-1])
+}
+
+// unescapeSQLString reverses mysqldump's default string escaping: both the
+// backslash-escape style (\', \\, \n, \r, \0, ...) and doubled quotes
+// ('').
+func unescapeSQLString(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case '0':
+				b.WriteByte(0)
+			case 'b':
+				b.WriteByte('\b')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'Z':
+				b.WriteByte(26)
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		if c == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
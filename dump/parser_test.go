@@ -0,0 +1,93 @@
+// Copyright 2019 siddontang All Rights Reserved.
+//
+// Licensed under the MIT License;
+// License can be found in the LICENSES/go-mysql-LICENSE.
+//
+// Copyright 2019 ByteWatch All Rights Reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitValues(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{`1,'a',NULL`, []string{"1", "'a'", "NULL"}},
+		{`1,'it''s',2`, []string{"1", "'it''s'", "2"}},
+		{`1,'it\'s',2`, []string{"1", `'it\'s'`, "2"}},
+		// A trailing backslash must be doubled by the writer (mysqldump
+		// escaping), or this would be mis-split into two values.
+		{`1,'C:\\',2`, []string{"1", `'C:\\'`, "2"}},
+		{`0x48656c6c6f,NULL`, []string{"0x48656c6c6f", "NULL"}},
+	}
+
+	for _, c := range cases {
+		got, err := splitValues(c.in)
+		if err != nil {
+			t.Fatalf("splitValues(%q) error: %v", c.in, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitValues(%q) = %#v, want %#v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestUnescapeValue(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"'it''s'", "it's"},
+		{`'it\'s'`, "it's"},
+		{`'a\nb'`, "a\nb"},
+		{`'a\\b'`, `a\b`},
+		{"123", "123"},
+		{"NULL", "NULL"},
+		{"0x48656c6c6f", "0x48656c6c6f"},
+	}
+
+	for _, c := range cases {
+		got := unescapeValue(c.in)
+		if got != c.want {
+			t.Errorf("unescapeValue(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	cases := []struct {
+		in   string
+		want interface{}
+	}{
+		{"NULL", nil},
+		{"123", int64(123)},
+		{"1.5", 1.5},
+		{"0x48656c6c6f", []byte("Hello")},
+		{`'it\'s'`, "it's"},
+		{"'plain'", "plain"},
+	}
+
+	for _, c := range cases {
+		got := typedValue(c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("typedValue(%q) = %#v (%T), want %#v (%T)", c.in, got, got, c.want, c.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 siddontang All Rights Reserved.
+//
+// Licensed under the MIT License;
+// License can be found in the LICENSES/go-mysql-LICENSE.
+//
+// Copyright 2019 ByteWatch All Rights Reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dump
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/juju/errors"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// snapshotPingInterval is how often keepalive runs SELECT 1 on the
+// consistent-snapshot transaction, so it stays open while mysqldump runs.
+const snapshotPingInterval = 30 * time.Second
+
+// consistentSnapshot holds a dedicated connection whose transaction pins an
+// InnoDB snapshot for the lifetime of a Dump call.
+type consistentSnapshot struct {
+	db   *sql.DB
+	conn *sql.Conn
+	tx   *sql.Tx
+	stop chan struct{}
+	done chan struct{}
+}
+
+// captureConsistentSnapshot opens a dedicated connection, starts a
+// REPEATABLE READ consistent-snapshot transaction, and writes a synthetic
+// "-- CHANGE MASTER TO ..." / "SET @@GLOBAL.GTID_PURGED=...;" header to w
+// from the binlog position and GTID set visible at that instant. It keeps
+// the transaction alive with idle pings until Close is called, so the
+// caller can safely run mysqldump --single-transaction against the same
+// server in the meantime without losing the snapshot.
+//
+// This needs only REPLICATION CLIENT (for SHOW MASTER STATUS), not the
+// SUPER/RELOAD privilege that --master-data requires.
+func (d *Dumper) captureConsistentSnapshot(w io.Writer) (*consistentSnapshot, error) {
+	db, err := sql.Open("mysql", d.dsn(""))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+
+	if _, err := conn.ExecContext(context.Background(), "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	if _, err := tx.Exec("START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		tx.Rollback()
+		conn.Close()
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+
+	var file string
+	var position uint64
+	var binlogDoDB, binlogIgnoreDB, executedGtidSet string
+	row := tx.QueryRow("SHOW MASTER STATUS")
+	if err := row.Scan(&file, &position, &binlogDoDB, &binlogIgnoreDB, &executedGtidSet); err != nil {
+		tx.Rollback()
+		conn.Close()
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	fmt.Fprintf(w, "-- CHANGE MASTER TO MASTER_LOG_FILE='%s', MASTER_LOG_POS=%d;\n", file, position)
+
+	var gtidExecuted string
+	if err := tx.QueryRow("SELECT @@GLOBAL.gtid_executed").Scan(&gtidExecuted); err != nil {
+		tx.Rollback()
+		conn.Close()
+		db.Close()
+		return nil, errors.Trace(err)
+	}
+	if len(gtidExecuted) != 0 {
+		fmt.Fprintf(w, "SET @@GLOBAL.GTID_PURGED='%s';\n", gtidExecuted)
+	}
+
+	s := &consistentSnapshot{
+		db:   db,
+		conn: conn,
+		tx:   tx,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.keepalive()
+
+	return s, nil
+}
+
+func (s *consistentSnapshot) keepalive() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(snapshotPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.tx.Exec("SELECT 1")
+		}
+	}
+}
+
+// Close stops the keepalive ping, ends the snapshot transaction and closes
+// the dedicated connection. It is safe to call once mysqldump has finished
+// reading.
+func (s *consistentSnapshot) Close() error {
+	close(s.stop)
+	<-s.done
+
+	err := s.tx.Rollback()
+	s.conn.Close()
+	s.db.Close()
+
+	return errors.Trace(err)
+}